@@ -0,0 +1,92 @@
+// Package app implements a typed application-layer API on top of the raw
+// TPDUs exposed by proto. It constructs the correct TPDU for each service
+// and routes it through a Transport (a Tunnel or Router).
+//
+// Point-to-point services (MemoryRead, AdcRead, MaskVersionRead, and so on)
+// are methods on Client: Client correlates the request it sends with the
+// matching response TPDU and hands back a decoded result, instead of making
+// callers switch on raw APCI codes via a Mux. Group communication
+// (GroupValueRead/Write/Response in group.go) is multicast and
+// fire-and-forget by nature, so it talks to a Transport directly and has no
+// response to correlate; consumers that need to react to group responses
+// register a Handler on a Mux.
+package app
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vapourismo/knx-go/knx/cemi"
+	"github.com/vapourismo/knx-go/knx/proto"
+)
+
+// ErrTimeout is returned when a request did not receive a matching response
+// within the configured timeout.
+var ErrTimeout = errors.New("app: timed out waiting for response")
+
+// ErrClosed reports a request made on a closed application. No function in
+// this package returns it; Client has no Close method.
+var ErrClosed = errors.New("app: application is closed")
+
+// DefaultResponseTimeout is how long a Client's request/response services
+// wait for the response; there is no per-call timeout. It is a var rather
+// than a const so tests can shrink it.
+var DefaultResponseTimeout = 5 * time.Second
+
+// A Transport is anything capable of sending a TPDU to a destination and
+// delivering inbound TPDUs back to the application layer, for example an
+// adapter around a KNXnet/IP tunnel or router connection.
+type Transport interface {
+	Send(dest cemi.IndividualAddr, tpdu proto.TPDU) error
+	Inbound() <-chan Inbound
+}
+
+// Inbound is a TPDU received from a Transport, tagged with its source.
+type Inbound struct {
+	Source cemi.IndividualAddr
+	TPDU   proto.TPDU
+}
+
+// A Handler processes an inbound TPDU for a registered APCI.
+type Handler func(source cemi.IndividualAddr, tpdu proto.TPDU)
+
+// A Mux dispatches inbound TPDUs to handlers registered per APCI, the way an
+// HTTP mux dispatches requests per path.
+type Mux struct {
+	mu       sync.RWMutex
+	handlers map[proto.APCI]Handler
+}
+
+// NewMux creates an empty Mux.
+func NewMux() *Mux {
+	return &Mux{handlers: make(map[proto.APCI]Handler)}
+}
+
+// Handle registers h to be invoked for every inbound TPDU whose Info matches
+// apci. Registering a handler for an APCI that already has one replaces it.
+func (mux *Mux) Handle(apci proto.APCI, h Handler) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	mux.handlers[apci] = h
+}
+
+// Dispatch looks up the handler registered for in.TPDU.Info and invokes it.
+// It is a no-op if no handler is registered.
+func (mux *Mux) Dispatch(in Inbound) {
+	mux.mu.RLock()
+	h := mux.handlers[in.TPDU.Info]
+	mux.mu.RUnlock()
+
+	if h != nil {
+		h(in.Source, in.TPDU)
+	}
+}
+
+// Serve reads Inbound values from transport until it is closed, dispatching
+// each to mux. It is meant to be run in its own goroutine.
+func (mux *Mux) Serve(transport Transport) {
+	for in := range transport.Inbound() {
+		mux.Dispatch(in)
+	}
+}
@@ -0,0 +1,49 @@
+package app
+
+import (
+	"testing"
+
+	"github.com/vapourismo/knx-go/knx/cemi"
+	"github.com/vapourismo/knx-go/knx/proto"
+)
+
+func TestMuxDispatchRoutesByAPCI(t *testing.T) {
+	mux := NewMux()
+
+	var gotGroupWrite, gotMaskVersion bool
+
+	mux.Handle(proto.GroupValueWrite, func(source cemi.IndividualAddr, tpdu proto.TPDU) {
+		gotGroupWrite = true
+	})
+	mux.Handle(proto.MaskVersionResponse, func(source cemi.IndividualAddr, tpdu proto.TPDU) {
+		gotMaskVersion = true
+	})
+
+	mux.Dispatch(Inbound{TPDU: proto.TPDU{Info: proto.GroupValueWrite}})
+
+	if !gotGroupWrite || gotMaskVersion {
+		t.Fatalf("expected only the GroupValueWrite handler to run, got groupWrite=%v maskVersion=%v", gotGroupWrite, gotMaskVersion)
+	}
+}
+
+func TestMuxDispatchNoHandlerIsNoop(t *testing.T) {
+	mux := NewMux()
+
+	// Must not panic in the absence of a registered handler.
+	mux.Dispatch(Inbound{TPDU: proto.TPDU{Info: proto.AdcResponse}})
+}
+
+func TestMuxDispatchReplacesHandler(t *testing.T) {
+	mux := NewMux()
+
+	var calls int
+
+	mux.Handle(proto.GroupValueRead, func(source cemi.IndividualAddr, tpdu proto.TPDU) { calls = 1 })
+	mux.Handle(proto.GroupValueRead, func(source cemi.IndividualAddr, tpdu proto.TPDU) { calls = 2 })
+
+	mux.Dispatch(Inbound{TPDU: proto.TPDU{Info: proto.GroupValueRead}})
+
+	if calls != 2 {
+		t.Fatalf("got %d, want 2 (second Handle call should replace the first)", calls)
+	}
+}
@@ -0,0 +1,127 @@
+package app
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vapourismo/knx-go/knx/cemi"
+	"github.com/vapourismo/knx-go/knx/proto"
+)
+
+// ErrCallInFlight is returned by a Client method when another call to the
+// same destination expecting the same response APCI is already pending.
+var ErrCallInFlight = errors.New("app: a call to that destination is already in flight")
+
+// callKey identifies a pending point-to-point call by the peer it was sent
+// to and the APCI of the response it is waiting for.
+type callKey struct {
+	dest cemi.IndividualAddr
+	info proto.APCI
+}
+
+// A Client issues point-to-point application-layer requests over a
+// proto.ConnectionOrientedTransport and correlates each one with its
+// matching response, so callers get a decoded result back from a single
+// method call instead of having to watch a Mux themselves.
+type Client struct {
+	transport *proto.ConnectionOrientedTransport
+
+	mu      sync.Mutex
+	pending map[callKey]chan proto.Payload
+}
+
+// NewClient creates a Client that issues requests through transport. It
+// starts a goroutine that reads transport.Inbound() for as long as
+// transport is alive and hands payloads to whichever call is waiting for
+// them; payloads with no matching call are dropped.
+func NewClient(transport *proto.ConnectionOrientedTransport) *Client {
+	client := &Client{
+		transport: transport,
+		pending:   make(map[callKey]chan proto.Payload),
+	}
+
+	go client.serve()
+
+	return client
+}
+
+func (client *Client) serve() {
+	for payload := range client.transport.Inbound() {
+		key := callKey{dest: payload.Source, info: payload.Info}
+
+		client.mu.Lock()
+		ch, ok := client.pending[key]
+		if ok {
+			delete(client.pending, key)
+		}
+		client.mu.Unlock()
+
+		if ok {
+			ch <- payload
+		}
+	}
+}
+
+// call connects to dest if there is no connection yet, sends a request
+// carrying reqInfo/data, and blocks until a payload carrying respInfo
+// arrives from dest, returning its data.
+func (client *Client) call(dest cemi.IndividualAddr, reqInfo proto.APCI, data []byte, respInfo proto.APCI) ([]byte, error) {
+	key := callKey{dest: dest, info: respInfo}
+	ch := make(chan proto.Payload, 1)
+
+	client.mu.Lock()
+	if _, exists := client.pending[key]; exists {
+		client.mu.Unlock()
+		return nil, ErrCallInFlight
+	}
+	client.pending[key] = ch
+	client.mu.Unlock()
+
+	if err := client.connect(dest); err != nil {
+		client.abandon(key)
+		return nil, err
+	}
+
+	if err := client.transport.Send(dest, reqInfo, data); err != nil {
+		client.abandon(key)
+		return nil, err
+	}
+
+	select {
+	case payload := <-ch:
+		return payload.Data, nil
+
+	case <-time.After(DefaultResponseTimeout):
+		client.abandon(key)
+		return nil, ErrTimeout
+	}
+}
+
+// send behaves like call but does not wait for an application-level
+// response, only for the transport-level acknowledgement of the request
+// itself. It is used by services that have nothing meaningful to decode
+// (e.g. RestartDevice) or whose response is not guaranteed (e.g.
+// MemoryWrite).
+func (client *Client) send(dest cemi.IndividualAddr, info proto.APCI, data []byte) error {
+	if err := client.connect(dest); err != nil {
+		return err
+	}
+
+	return client.transport.Send(dest, info, data)
+}
+
+func (client *Client) connect(dest cemi.IndividualAddr) error {
+	err := client.transport.Connect(dest)
+	if err == proto.ErrAlreadyConnected {
+		return nil
+	}
+
+	return err
+}
+
+func (client *Client) abandon(key callKey) {
+	client.mu.Lock()
+	delete(client.pending, key)
+	client.mu.Unlock()
+}
@@ -0,0 +1,148 @@
+package app
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vapourismo/knx-go/knx/cemi"
+	"github.com/vapourismo/knx-go/knx/proto"
+)
+
+// sentFrame is one TPDU handed to a fakeSender.
+type sentFrame struct {
+	addr cemi.IndividualAddr
+	tpdu proto.TPDU
+}
+
+// fakeSender is a proto.FrameSender that records every TPDU it is asked to
+// send instead of putting it on the wire.
+type fakeSender struct {
+	frames chan sentFrame
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{frames: make(chan sentFrame, 16)}
+}
+
+func (f *fakeSender) Send(addr cemi.IndividualAddr, tpdu proto.TPDU) error {
+	f.frames <- sentFrame{addr, tpdu}
+	return nil
+}
+
+func (f *fakeSender) recv(t *testing.T) sentFrame {
+	t.Helper()
+
+	select {
+	case frame := <-f.frames:
+		return frame
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a frame to be sent")
+		return sentFrame{}
+	}
+}
+
+// answer plays the device side of a request/response exchange: it acks the
+// numbered data packet that carried the request (frame), then sends back a
+// numbered data packet carrying respInfo/respData as the response, and drains
+// the ack our side sends for it.
+func answer(t *testing.T, sender *fakeSender, transport *proto.ConnectionOrientedTransport, dest cemi.IndividualAddr, frame sentFrame, respInfo proto.APCI, respData []byte) {
+	t.Helper()
+
+	transport.Dispatch(dest, proto.TPDU{PacketType: proto.NumberedControlPacket, SeqNumber: frame.tpdu.SeqNumber, Control: proto.Ack})
+	transport.Dispatch(dest, proto.TPDU{PacketType: proto.NumberedDataPacket, SeqNumber: 0, Info: respInfo, Data: respData})
+	sender.recv(t) // the ack our side sends back for that response
+}
+
+func TestClientCallSuccess(t *testing.T) {
+	sender := newFakeSender()
+	transport := proto.NewConnectionOrientedTransport(sender)
+	client := NewClient(transport)
+	dest := cemi.IndividualAddr(1)
+
+	type result struct {
+		value uint16
+		err   error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		value, err := client.MaskVersionRead(dest)
+		resultCh <- result{value, err}
+	}()
+
+	sender.recv(t) // T_CONNECT
+	req := sender.recv(t)
+	if req.tpdu.PacketType != proto.NumberedDataPacket || req.tpdu.Info != proto.MaskVersionRead {
+		t.Fatalf("unexpected request frame: %+v", req.tpdu)
+	}
+
+	answer(t, sender, transport, dest, req, proto.MaskVersionResponse, []byte{0x07, 0xB0})
+
+	got := <-resultCh
+	if got.err != nil {
+		t.Fatalf("MaskVersionRead: %v", got.err)
+	}
+	if got.value != 0x07B0 {
+		t.Fatalf("got mask version %#x, want 0x07b0", got.value)
+	}
+}
+
+func TestClientCallInFlight(t *testing.T) {
+	sender := newFakeSender()
+	transport := proto.NewConnectionOrientedTransport(sender)
+	client := NewClient(transport)
+	dest := cemi.IndividualAddr(2)
+
+	done := make(chan struct{})
+	go func() {
+		client.MaskVersionRead(dest)
+		close(done)
+	}()
+
+	sender.recv(t) // T_CONNECT from the first call
+
+	if _, err := client.MaskVersionRead(dest); err != ErrCallInFlight {
+		t.Fatalf("second call: got %v, want ErrCallInFlight", err)
+	}
+
+	// Let the first call finish so it doesn't leak past the test.
+	req := sender.recv(t)
+	answer(t, sender, transport, dest, req, proto.MaskVersionResponse, []byte{0, 0})
+	<-done
+}
+
+func TestClientCallTimeout(t *testing.T) {
+	old := DefaultResponseTimeout
+	DefaultResponseTimeout = 20 * time.Millisecond
+	defer func() { DefaultResponseTimeout = old }()
+
+	sender := newFakeSender()
+	transport := proto.NewConnectionOrientedTransport(sender)
+	client := NewClient(transport)
+	dest := cemi.IndividualAddr(3)
+
+	type result struct {
+		value uint16
+		err   error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		value, err := client.MaskVersionRead(dest)
+		resultCh <- result{value, err}
+	}()
+
+	sender.recv(t) // T_CONNECT
+	req := sender.recv(t)
+
+	// Ack the request so the transport-level send completes, but never send
+	// back an application-level MaskVersionResponse.
+	transport.Dispatch(dest, proto.TPDU{PacketType: proto.NumberedControlPacket, SeqNumber: req.tpdu.SeqNumber, Control: proto.Ack})
+
+	select {
+	case got := <-resultCh:
+		if got.err != ErrTimeout {
+			t.Fatalf("got err %v, want ErrTimeout", got.err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for MaskVersionRead to give up")
+	}
+}
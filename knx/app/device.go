@@ -0,0 +1,100 @@
+package app
+
+import (
+	"errors"
+
+	"github.com/vapourismo/knx-go/knx/cemi"
+	"github.com/vapourismo/knx-go/knx/proto"
+)
+
+// ErrAdcResponseTooShort is returned by DecodeAdcResponse when the payload
+// is shorter than the fixed ADC response layout.
+var ErrAdcResponseTooShort = errors.New("app: ADC response is too short")
+
+// ErrMaskVersionResponseTooShort is returned by MaskVersionRead when the
+// payload of the MaskVersionResponse it received is too short.
+var ErrMaskVersionResponseTooShort = errors.New("app: mask version response is too short")
+
+// AdcRead requests count samples from channel on dest and returns the
+// accumulated value once the matching AdcResponse arrives.
+func (client *Client) AdcRead(dest cemi.IndividualAddr, channel uint8, count uint8) (uint16, error) {
+	data, err := client.call(dest, proto.AdcRead, []byte{channel & 63, count}, proto.AdcResponse)
+	if err != nil {
+		return 0, err
+	}
+
+	_, _, value, err := DecodeAdcResponse(data)
+	return value, err
+}
+
+// AdcResponse sends the accumulated ADC value back to dest, answering an
+// AdcRead. It is used by the device side of the service, so it talks to the
+// numbered transport directly rather than through a Client's pending-call
+// table.
+func AdcResponse(transport *proto.ConnectionOrientedTransport, dest cemi.IndividualAddr, channel uint8, count uint8, value uint16) error {
+	return transport.Send(dest, proto.AdcResponse, []byte{channel & 63, count, byte(value >> 8), byte(value)})
+}
+
+// DecodeAdcResponse extracts the channel, sample count and accumulated value
+// from the payload of an AdcResponse TPDU.
+func DecodeAdcResponse(data []byte) (channel uint8, count uint8, value uint16, err error) {
+	if len(data) < 4 {
+		return 0, 0, 0, ErrAdcResponseTooShort
+	}
+
+	return data[0] & 63, data[1], uint16(data[2])<<8 | uint16(data[3]), nil
+}
+
+// MaskVersionRead requests dest's mask version and returns it once the
+// matching MaskVersionResponse arrives.
+func (client *Client) MaskVersionRead(dest cemi.IndividualAddr) (uint16, error) {
+	data, err := client.call(dest, proto.MaskVersionRead, nil, proto.MaskVersionResponse)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(data) < 2 {
+		return 0, ErrMaskVersionResponseTooShort
+	}
+
+	return uint16(data[0])<<8 | uint16(data[1]), nil
+}
+
+// MaskVersionResponse sends the device's mask version back to dest,
+// answering a MaskVersionRead. It is used by the device side of the
+// service, so it talks to the numbered transport directly rather than
+// through a Client's pending-call table.
+func MaskVersionResponse(transport *proto.ConnectionOrientedTransport, dest cemi.IndividualAddr, maskVersion uint16) error {
+	return transport.Send(dest, proto.MaskVersionResponse, []byte{byte(maskVersion >> 8), byte(maskVersion)})
+}
+
+// IndividualAddrWrite sends a request to program newAddr as the individual
+// address of whichever device is currently in programming mode. dest should
+// be the broadcast address (0). This is sent unnumbered on a plain
+// Transport rather than through a Client, since the target has no
+// individual address yet to hold a numbered-transport connection with.
+func IndividualAddrWrite(transport Transport, dest cemi.IndividualAddr, newAddr cemi.IndividualAddr) error {
+	return transport.Send(dest, proto.TPDU{
+		PacketType: proto.UnnumberedDataPacket,
+		Info:       proto.IndividualAddrWrite,
+		Data:       []byte{byte(newAddr >> 8), byte(newAddr)},
+	})
+}
+
+// IndividualAddrRequest broadcasts a request asking whichever device is in
+// programming mode to report its individual address. Like
+// IndividualAddrWrite, this is sent unnumbered since the target is not
+// addressable yet.
+func IndividualAddrRequest(transport Transport, dest cemi.IndividualAddr) error {
+	return transport.Send(dest, proto.TPDU{
+		PacketType: proto.UnnumberedDataPacket,
+		Info:       proto.IndividualAddrRequest,
+	})
+}
+
+// RestartDevice sends a Restart request to dest and waits for the
+// transport-level acknowledgement, asking the device to perform a basic
+// restart. There is no application-level response to a Restart.
+func (client *Client) RestartDevice(dest cemi.IndividualAddr) error {
+	return client.send(dest, proto.Restart, nil)
+}
@@ -0,0 +1,41 @@
+package app
+
+import (
+	"github.com/vapourismo/knx-go/knx/cemi"
+	"github.com/vapourismo/knx-go/knx/proto"
+)
+
+// A DatapointValue is anything that can be packed into and unpacked from the
+// payload of a group communication service (GroupValueWrite/Response).
+type DatapointValue interface {
+	Pack() []byte
+	Unpack(data []byte) error
+}
+
+// GroupValueRead sends a GroupValueRead request for dest through transport.
+func GroupValueRead(transport Transport, dest cemi.IndividualAddr) error {
+	return transport.Send(dest, proto.TPDU{
+		PacketType: proto.UnnumberedDataPacket,
+		Info:       proto.GroupValueRead,
+	})
+}
+
+// GroupValueResponse sends value as the payload of a GroupValueResponse to
+// dest through transport.
+func GroupValueResponse(transport Transport, dest cemi.IndividualAddr, value DatapointValue) error {
+	return transport.Send(dest, proto.TPDU{
+		PacketType: proto.UnnumberedDataPacket,
+		Info:       proto.GroupValueResponse,
+		Data:       value.Pack(),
+	})
+}
+
+// GroupValueWrite sends value as the payload of a GroupValueWrite to dest
+// through transport.
+func GroupValueWrite(transport Transport, dest cemi.IndividualAddr, value DatapointValue) error {
+	return transport.Send(dest, proto.TPDU{
+		PacketType: proto.UnnumberedDataPacket,
+		Info:       proto.GroupValueWrite,
+		Data:       value.Pack(),
+	})
+}
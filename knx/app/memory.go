@@ -0,0 +1,56 @@
+package app
+
+import (
+	"errors"
+
+	"github.com/vapourismo/knx-go/knx/cemi"
+	"github.com/vapourismo/knx-go/knx/proto"
+)
+
+// ErrMemoryResponseTooShort is returned by DecodeMemoryResponse when the
+// payload is shorter than its 3-byte count and address header.
+var ErrMemoryResponseTooShort = errors.New("app: memory response is too short")
+
+// MemoryRead requests n bytes of memory at addr from dest over the
+// client's numbered transport connection and returns the data once the
+// matching MemoryResponse arrives.
+func (client *Client) MemoryRead(dest cemi.IndividualAddr, addr uint16, n uint8) ([]byte, error) {
+	data, err := client.call(dest, proto.MemoryRead, []byte{n, byte(addr >> 8), byte(addr)}, proto.MemoryResponse)
+	if err != nil {
+		return nil, err
+	}
+
+	_, _, payload, err := DecodeMemoryResponse(data)
+	return payload, err
+}
+
+// MemoryWrite writes data at addr on dest and waits for the transport-level
+// acknowledgement of the request. It does not wait for an application-level
+// MemoryResponse, since a device is not required to send one for a write.
+func (client *Client) MemoryWrite(dest cemi.IndividualAddr, addr uint16, data []byte) error {
+	payload := append([]byte{uint8(len(data)), byte(addr >> 8), byte(addr)}, data...)
+	return client.send(dest, proto.MemoryWrite, payload)
+}
+
+// MemoryResponse sends data read from addr back to dest over transport,
+// answering a MemoryRead. It is used by the device side of the service, so
+// it talks to the numbered transport directly rather than through a
+// Client's pending-call table.
+func MemoryResponse(transport *proto.ConnectionOrientedTransport, dest cemi.IndividualAddr, addr uint16, data []byte) error {
+	payload := append([]byte{uint8(len(data)), byte(addr >> 8), byte(addr)}, data...)
+	return transport.Send(dest, proto.MemoryResponse, payload)
+}
+
+// DecodeMemoryResponse extracts the byte count, address and data from the
+// payload of a MemoryResponse/MemoryWrite/MemoryRead TPDU.
+func DecodeMemoryResponse(data []byte) (n uint8, addr uint16, payload []byte, err error) {
+	if len(data) < 3 {
+		return 0, 0, nil, ErrMemoryResponseTooShort
+	}
+
+	n = data[0]
+	addr = uint16(data[1])<<8 | uint16(data[2])
+	payload = data[3:]
+
+	return n, addr, payload, nil
+}
@@ -0,0 +1,61 @@
+package capture
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// A Format selects the on-disk encoding used by Recorder and Replay.
+type Format uint8
+
+// Supported capture formats.
+const (
+	// JSONLines stores one JSON-encoded Frame per line.
+	JSONLines Format = iota
+
+	// Pcap stores frames using the classic pcap file format with
+	// LinkTypeUser0, the link-layer type Wireshark's KNXnet/IP dissector is
+	// bound to for raw frame captures. Since that format has no field of its
+	// own to carry a frame's direction, inbound and outbound frames are
+	// recorded to separate files rather than tagging the frame bytes
+	// themselves (see Recorder and NewPcapReplay).
+	Pcap
+)
+
+// LinkTypeUser0 is the pcap link-layer type used for Pcap-formatted
+// captures.
+const LinkTypeUser0 = 147
+
+// pcapMagic is the pcap file magic number (microsecond timestamp
+// resolution). It and every other pcap field are written little-endian.
+const pcapMagic = 0xa1b2c3d4
+
+// ErrBadMagic is returned by NewPcapReplay when an input's global header
+// does not carry the pcap magic number.
+var ErrBadMagic = errors.New("capture: not a pcap capture file")
+
+// writePcapGlobalHeader writes the 24-byte pcap global header for
+// LinkTypeUser0 captures.
+func writePcapGlobalHeader(buf []byte) []byte {
+	buf = appendUint32(buf, pcapMagic)
+	buf = appendUint16(buf, 2) // version major
+	buf = appendUint16(buf, 4) // version minor
+	buf = appendUint32(buf, 0) // thiszone
+	buf = appendUint32(buf, 0) // sigfigs
+	buf = appendUint32(buf, 1<<16)
+	buf = appendUint32(buf, LinkTypeUser0)
+
+	return buf
+}
+
+func appendUint16(buf []byte, v uint16) []byte {
+	var tmp [2]byte
+	binary.LittleEndian.PutUint16(tmp[:], v)
+	return append(buf, tmp[:]...)
+}
+
+func appendUint32(buf []byte, v uint32) []byte {
+	var tmp [4]byte
+	binary.LittleEndian.PutUint32(tmp[:], v)
+	return append(buf, tmp[:]...)
+}
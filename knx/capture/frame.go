@@ -0,0 +1,32 @@
+// Package capture tees inbound and outbound KNXnet/IP, CEMI and TPDU frames
+// into one or more files for offline debugging and regression testing, and
+// replays them back through the decoder.
+package capture
+
+import "time"
+
+// A Direction tags a captured Frame as having been received from or sent to
+// the bus.
+type Direction uint8
+
+// Directions a Frame can have been captured in.
+const (
+	Inbound  Direction = 0
+	Outbound Direction = 1
+)
+
+// String returns "in" or "out".
+func (dir Direction) String() string {
+	if dir == Outbound {
+		return "out"
+	}
+
+	return "in"
+}
+
+// A Frame is a single captured frame together with its capture metadata.
+type Frame struct {
+	Timestamp time.Time
+	Direction Direction
+	Data      []byte
+}
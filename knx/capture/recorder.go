@@ -0,0 +1,206 @@
+package capture
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// A RotatePolicy decides when a Recorder should roll over to a new
+// underlying file.
+type RotatePolicy struct {
+	// MaxBytes is the number of bytes written to a file before it is
+	// rotated. Zero disables size-based rotation.
+	MaxBytes int64
+}
+
+// NewFile is called by a Recorder whenever it needs a new file to write to,
+// numbered sequentially starting at 0. JSONLines captures record every
+// direction inline in a single sequence and always call this with
+// dir == Inbound; Pcap captures keep a separate numbered sequence per
+// Direction (see Recorder), so dir reflects whichever one is rotating.
+type NewFile func(dir Direction, seq int) (io.WriteCloser, error)
+
+// jsonFrame is the on-disk representation of a Frame in JSONLines format.
+type jsonFrame struct {
+	Timestamp time.Time `json:"timestamp"`
+	Direction string    `json:"direction"`
+	Data      []byte    `json:"data"`
+}
+
+// stream is one rotating, sequentially-numbered file.
+type stream struct {
+	seq     int
+	written int64
+	cur     io.WriteCloser
+}
+
+// A Recorder tees captured frames into a sequence of files according to
+// format and policy, so inbound and outbound traffic can be replayed later
+// with Replay or NewPcapReplay.
+type Recorder struct {
+	mu      sync.Mutex
+	format  Format
+	policy  RotatePolicy
+	newFile NewFile
+
+	// shared is used by JSONLines captures, which interleave both
+	// directions into one sequence. perDir is used by Pcap captures, which
+	// keep inbound and outbound in their own sequence of files instead of
+	// tagging the frame bytes (see Format.Pcap).
+	shared *stream
+	perDir map[Direction]*stream
+}
+
+// NewRecorder creates a Recorder. newFile is invoked to obtain the first
+// file in each sequence it needs, and again after every rotation.
+func NewRecorder(format Format, policy RotatePolicy, newFile NewFile) (*Recorder, error) {
+	rec := &Recorder{format: format, policy: policy, newFile: newFile}
+
+	if format == Pcap {
+		rec.perDir = map[Direction]*stream{
+			Inbound:  {seq: -1},
+			Outbound: {seq: -1},
+		}
+
+		for dir, s := range rec.perDir {
+			if err := rec.rotate(dir, s); err != nil {
+				return nil, err
+			}
+		}
+	} else {
+		rec.shared = &stream{seq: -1}
+
+		if err := rec.rotate(Inbound, rec.shared); err != nil {
+			return nil, err
+		}
+	}
+
+	return rec, nil
+}
+
+// Record captures payload, tagged with dir and the current time. It rotates
+// to a new file first if the active one has reached policy.MaxBytes.
+func (rec *Recorder) Record(dir Direction, payload []byte) error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	frame := Frame{Timestamp: time.Now(), Direction: dir, Data: payload}
+
+	if rec.format == Pcap {
+		s := rec.perDir[dir]
+
+		if rec.policy.MaxBytes > 0 && s.written >= rec.policy.MaxBytes {
+			if err := rec.rotate(dir, s); err != nil {
+				return err
+			}
+		}
+
+		n, err := rec.writePcapFrame(s, frame)
+		s.written += int64(n)
+		return err
+	}
+
+	s := rec.shared
+
+	if rec.policy.MaxBytes > 0 && s.written >= rec.policy.MaxBytes {
+		if err := rec.rotate(Inbound, s); err != nil {
+			return err
+		}
+	}
+
+	n, err := rec.writeJSONFrame(s, frame)
+	s.written += int64(n)
+	return err
+}
+
+// Close closes every currently active file.
+func (rec *Recorder) Close() error {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+
+	if rec.shared != nil && rec.shared.cur != nil {
+		if err := rec.shared.cur.Close(); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range rec.perDir {
+		if s.cur == nil {
+			continue
+		}
+
+		if err := s.cur.Close(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rotate closes s's active file, if any, and opens the next one in its
+// sequence. rec.mu must be held by the caller.
+func (rec *Recorder) rotate(dir Direction, s *stream) error {
+	if s.cur != nil {
+		if err := s.cur.Close(); err != nil {
+			return err
+		}
+	}
+
+	s.seq++
+
+	w, err := rec.newFile(dir, s.seq)
+	if err != nil {
+		return err
+	}
+
+	s.cur = w
+	s.written = 0
+
+	if rec.format == Pcap {
+		header := writePcapGlobalHeader(nil)
+
+		n, err := w.Write(header)
+		if err != nil {
+			return err
+		}
+
+		s.written += int64(n)
+	}
+
+	return nil
+}
+
+// writeJSONFrame appends frame to s's active file as a single JSON line.
+func (rec *Recorder) writeJSONFrame(s *stream, frame Frame) (int, error) {
+	line, err := json.Marshal(jsonFrame{
+		Timestamp: frame.Timestamp,
+		Direction: frame.Direction.String(),
+		Data:      frame.Data,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	line = append(line, '\n')
+
+	return s.cur.Write(line)
+}
+
+// writePcapFrame appends frame to s's active file as a pcap packet record.
+// s is always the stream for frame.Direction, so the record carries exactly
+// the bytes a dissector would see on the wire, with no tag byte to corrupt
+// it.
+func (rec *Recorder) writePcapFrame(s *stream, frame Frame) (int, error) {
+	sec := frame.Timestamp.Unix()
+	usec := frame.Timestamp.Nanosecond() / 1000
+
+	record := appendUint32(nil, uint32(sec))
+	record = appendUint32(record, uint32(usec))
+	record = appendUint32(record, uint32(len(frame.Data)))
+	record = appendUint32(record, uint32(len(frame.Data)))
+	record = append(record, frame.Data...)
+
+	return s.cur.Write(record)
+}
@@ -0,0 +1,153 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"testing"
+)
+
+// memFile is an in-memory io.WriteCloser used in place of a real file.
+type memFile struct {
+	*bytes.Buffer
+}
+
+func (memFile) Close() error { return nil }
+
+func TestRecorderJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+
+	rec, err := NewRecorder(JSONLines, RotatePolicy{}, func(dir Direction, seq int) (io.WriteCloser, error) {
+		return memFile{&buf}, nil
+	})
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+
+	if err := rec.Record(Inbound, []byte{0x01, 0x02}); err != nil {
+		t.Fatalf("Record(Inbound): %v", err)
+	}
+	if err := rec.Record(Outbound, []byte{0x03}); err != nil {
+		t.Fatalf("Record(Outbound): %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	lines := bytes.Split(bytes.TrimRight(buf.Bytes(), "\n"), []byte("\n"))
+	if len(lines) != 2 {
+		t.Fatalf("got %d lines, want 2 (%q)", len(lines), buf.String())
+	}
+
+	var first, second jsonFrame
+	if err := json.Unmarshal(lines[0], &first); err != nil {
+		t.Fatalf("unmarshal first line: %v", err)
+	}
+	if err := json.Unmarshal(lines[1], &second); err != nil {
+		t.Fatalf("unmarshal second line: %v", err)
+	}
+
+	if first.Direction != Inbound.String() || !bytes.Equal(first.Data, []byte{0x01, 0x02}) {
+		t.Fatalf("unexpected first frame: %+v", first)
+	}
+	if second.Direction != Outbound.String() || !bytes.Equal(second.Data, []byte{0x03}) {
+		t.Fatalf("unexpected second frame: %+v", second)
+	}
+}
+
+func TestRecorderPcapSplitsByDirection(t *testing.T) {
+	files := make(map[Direction]*bytes.Buffer)
+
+	rec, err := NewRecorder(Pcap, RotatePolicy{}, func(dir Direction, seq int) (io.WriteCloser, error) {
+		buf, ok := files[dir]
+		if !ok {
+			buf = &bytes.Buffer{}
+			files[dir] = buf
+		}
+		return memFile{buf}, nil
+	})
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+
+	inData := []byte{0xAA, 0xBB, 0xCC}
+	outData := []byte{0xDD}
+
+	if err := rec.Record(Inbound, inData); err != nil {
+		t.Fatalf("Record(Inbound): %v", err)
+	}
+	if err := rec.Record(Outbound, outData); err != nil {
+		t.Fatalf("Record(Outbound): %v", err)
+	}
+	if err := rec.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	if len(files) != 2 {
+		t.Fatalf("expected a separate file per direction, got %d files", len(files))
+	}
+
+	checkPcapFrame(t, files[Inbound].Bytes(), inData)
+	checkPcapFrame(t, files[Outbound].Bytes(), outData)
+}
+
+// checkPcapFrame asserts that raw is a valid pcap global header followed by
+// exactly one packet record whose body is want, with no extra tag byte.
+func checkPcapFrame(t *testing.T, raw []byte, want []byte) {
+	t.Helper()
+
+	if len(raw) < 24 {
+		t.Fatalf("file too short for a pcap global header: %d bytes", len(raw))
+	}
+
+	if magic := binary.LittleEndian.Uint32(raw[:4]); magic != pcapMagic {
+		t.Fatalf("bad pcap magic: %x", magic)
+	}
+	if linkType := binary.LittleEndian.Uint32(raw[20:24]); linkType != LinkTypeUser0 {
+		t.Fatalf("got link type %d, want %d", linkType, LinkTypeUser0)
+	}
+
+	record := raw[24:]
+	if len(record) < 16 {
+		t.Fatalf("record header too short: %d bytes", len(record))
+	}
+
+	inclLen := binary.LittleEndian.Uint32(record[8:12])
+	origLen := binary.LittleEndian.Uint32(record[12:16])
+	body := record[16:]
+
+	if int(inclLen) != len(want) || int(origLen) != len(want) {
+		t.Fatalf("record length %d/%d, want %d (direction tag byte leaking in?)", inclLen, origLen, len(want))
+	}
+	if !bytes.Equal(body, want) {
+		t.Fatalf("record body %x, want %x", body, want)
+	}
+}
+
+func TestRecorderRotation(t *testing.T) {
+	var seqs []int
+
+	rec, err := NewRecorder(JSONLines, RotatePolicy{MaxBytes: 1}, func(dir Direction, seq int) (io.WriteCloser, error) {
+		seqs = append(seqs, seq)
+		return memFile{&bytes.Buffer{}}, nil
+	})
+	if err != nil {
+		t.Fatalf("NewRecorder: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := rec.Record(Inbound, []byte{byte(i)}); err != nil {
+			t.Fatalf("Record: %v", err)
+		}
+	}
+
+	if len(seqs) != 3 { // initial file (seq 0) plus a rotation before the 2nd and 3rd records
+		t.Fatalf("got %d files opened (%v), want 3", len(seqs), seqs)
+	}
+	for i, seq := range seqs {
+		if seq != i {
+			t.Fatalf("file sequence numbers out of order: %v", seqs)
+		}
+	}
+}
@@ -0,0 +1,212 @@
+package capture
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/vapourismo/knx-go/knx/proto"
+)
+
+// A Handler processes a replayed Frame together with its decoded TPDU.
+type Handler func(frame Frame, tpdu proto.TPDU) error
+
+// A Replay reads frames previously written by a Recorder and dispatches
+// them to a Handler, so bus traffic can be debugged offline or used as a
+// regression test fixture without a live gateway.
+type Replay struct {
+	format Format
+
+	// json is set for JSONLines captures, which read a single interleaved
+	// stream. pcap is set for Pcap captures, which keep inbound and
+	// outbound in separate files and so need one decoder per Direction,
+	// merged back into timestamp order by next().
+	json *bufio.Reader
+	pcap map[Direction]*pcapDecoder
+}
+
+// NewReplay opens a Replay over r, which must contain frames written in
+// JSONLines format by a Recorder. Use NewPcapReplay for Pcap captures.
+func NewReplay(r io.Reader, format Format) (*Replay, error) {
+	if format != JSONLines {
+		return nil, errors.New("capture: NewReplay only reads JSONLines captures; use NewPcapReplay for Pcap")
+	}
+
+	return &Replay{format: format, json: bufio.NewReader(r)}, nil
+}
+
+// NewPcapReplay opens a Replay over the pair of pcap streams a Recorder
+// writes in Pcap format, one per Direction. Frames are merged back into
+// timestamp order as they are read.
+func NewPcapReplay(inbound, outbound io.Reader) (*Replay, error) {
+	readers := map[Direction]io.Reader{Inbound: inbound, Outbound: outbound}
+	decoders := make(map[Direction]*pcapDecoder, len(readers))
+
+	for dir, r := range readers {
+		d, err := newPcapDecoder(r)
+		if err != nil {
+			return nil, err
+		}
+
+		decoders[dir] = d
+	}
+
+	for dir, d := range decoders {
+		if err := d.advance(dir); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Replay{format: Pcap, pcap: decoders}, nil
+}
+
+// Run reads every captured frame in order and invokes handler with it and
+// its decoded TPDU. speed scales the gap between consecutive frames'
+// timestamps: speed <= 0 replays as fast as possible, 1 reproduces the
+// original pace, and values above or below 1 accelerate or slow it down.
+// Run returns nil at the end of input, or the first error returned by
+// handler or encountered while decoding.
+func (replay *Replay) Run(speed float64, handler Handler) error {
+	var prev time.Time
+
+	for {
+		frame, err := replay.next()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if speed > 0 && !prev.IsZero() {
+			if gap := frame.Timestamp.Sub(prev); gap > 0 {
+				time.Sleep(time.Duration(float64(gap) / speed))
+			}
+		}
+		prev = frame.Timestamp
+
+		var tpdu proto.TPDU
+		if err := tpdu.ReadFrom(bytes.NewReader(frame.Data)); err != nil {
+			return err
+		}
+
+		if err := handler(frame, tpdu); err != nil {
+			return err
+		}
+	}
+}
+
+func (replay *Replay) next() (Frame, error) {
+	if replay.format == Pcap {
+		return replay.nextPcap()
+	}
+
+	return replay.nextJSON()
+}
+
+func (replay *Replay) nextJSON() (Frame, error) {
+	line, err := replay.json.ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return Frame{}, err
+	}
+
+	var jf jsonFrame
+	if jErr := json.Unmarshal(bytes.TrimSpace(line), &jf); jErr != nil {
+		return Frame{}, jErr
+	}
+
+	dir := Inbound
+	if jf.Direction == Outbound.String() {
+		dir = Outbound
+	}
+
+	return Frame{Timestamp: jf.Timestamp, Direction: dir, Data: jf.Data}, nil
+}
+
+// nextPcap returns whichever of the per-direction decoders is holding the
+// earliest unread frame, then advances that decoder.
+func (replay *Replay) nextPcap() (Frame, error) {
+	var (
+		bestDir   Direction
+		bestFrame *Frame
+	)
+
+	for dir, d := range replay.pcap {
+		if d.next == nil {
+			continue
+		}
+
+		if bestFrame == nil || d.next.Timestamp.Before(bestFrame.Timestamp) {
+			bestDir, bestFrame = dir, d.next
+		}
+	}
+
+	if bestFrame == nil {
+		return Frame{}, io.EOF
+	}
+
+	frame := *bestFrame
+
+	if err := replay.pcap[bestDir].advance(bestDir); err != nil {
+		return Frame{}, err
+	}
+
+	return frame, nil
+}
+
+// pcapDecoder reads pcap packet records from a single direction's file, with
+// one frame of lookahead so Replay can merge multiple directions by
+// timestamp.
+type pcapDecoder struct {
+	r    *bufio.Reader
+	next *Frame
+}
+
+func newPcapDecoder(r io.Reader) (*pcapDecoder, error) {
+	br := bufio.NewReader(r)
+
+	var header [24]byte
+	if _, err := io.ReadFull(br, header[:]); err != nil {
+		return nil, err
+	}
+
+	if binary.LittleEndian.Uint32(header[:4]) != pcapMagic {
+		return nil, ErrBadMagic
+	}
+
+	return &pcapDecoder{r: br}, nil
+}
+
+// advance reads the next record into d.next, tagging it with dir, or sets
+// d.next to nil once the stream is exhausted.
+func (d *pcapDecoder) advance(dir Direction) error {
+	var header [16]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		if err == io.EOF {
+			d.next = nil
+			return nil
+		}
+
+		return err
+	}
+
+	sec := binary.LittleEndian.Uint32(header[0:4])
+	usec := binary.LittleEndian.Uint32(header[4:8])
+	inclLen := binary.LittleEndian.Uint32(header[8:12])
+
+	data := make([]byte, inclLen)
+	if _, err := io.ReadFull(d.r, data); err != nil {
+		return err
+	}
+
+	d.next = &Frame{
+		Timestamp: time.Unix(int64(sec), int64(usec)*1000),
+		Direction: dir,
+		Data:      data,
+	}
+
+	return nil
+}
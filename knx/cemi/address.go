@@ -0,0 +1,23 @@
+// Package cemi contains addressing types shared by the transport and
+// application layers.
+package cemi
+
+import "fmt"
+
+// A GroupAddr is a KNX group address.
+type GroupAddr uint16
+
+// String generates the string representation of a GroupAddr in its
+// 3-level notation (main/middle/sub).
+func (addr GroupAddr) String() string {
+	return fmt.Sprintf("%d/%d/%d", (addr>>11)&31, (addr>>8)&7, addr&255)
+}
+
+// An IndividualAddr is a KNX individual (device) address.
+type IndividualAddr uint16
+
+// String generates the string representation of an IndividualAddr in its
+// area.line.device notation.
+func (addr IndividualAddr) String() string {
+	return fmt.Sprintf("%d.%d.%d", (addr>>12)&15, (addr>>8)&15, addr&255)
+}
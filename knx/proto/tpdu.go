@@ -1,11 +1,8 @@
 package proto
 
 import (
-	"bytes"
 	"errors"
 	"io"
-
-	"github.com/vapourismo/knx-go/knx/binary"
 )
 
 // A TPCI is the transport-layer protocol control information (TPCI).
@@ -19,8 +16,15 @@ const (
 	NumberedControlPacket   TPCI = 3
 )
 
-// An APCI is the application-layer protocol control information (APCI).
-type APCI uint8
+// An APCI is the application-layer protocol control information (APCI). It
+// is a 10-bit value: the 4-bit codes below (0-14) are carried directly in
+// the TPDU header and the first data octet, while Escape (15) marks that the
+// actual code is one of the extended codes below, carried in the low 6 bits
+// of the first data octet (giving a 10-bit code space of 0x3C0-0x3FF).
+// Existing code that only ever compares against the 4-bit constants keeps
+// working unchanged, since those constants and their values are unaffected
+// by the widened type.
+type APCI uint16
 
 //
 const (
@@ -42,6 +46,39 @@ const (
 	Escape                 APCI = 15
 )
 
+// escapeBase is the 10-bit value of an extended APCI code whose 6 low bits
+// are all zero, i.e. Escape shifted into the top 4 bits of the 10-bit space.
+const escapeBase APCI = Escape << 6
+
+// Extended APCI codes, carried via Escape. These only ever appear as the
+// value of TPDU.Info; they are never assigned to the wire TPCI/APCI header
+// bits directly.
+const (
+	Authorize                   APCI = escapeBase | 0x11
+	KeyWrite                    APCI = escapeBase | 0x13
+	KeyResponse                 APCI = escapeBase | 0x14
+	PropertyValueRead           APCI = escapeBase | 0x15
+	PropertyValueResponse       APCI = escapeBase | 0x16
+	PropertyValueWrite          APCI = escapeBase | 0x17
+	FunctionPropertyCommand     APCI = escapeBase | 0x18
+	NetworkParameterRead        APCI = escapeBase | 0x1B
+	NetworkParameterResponse    APCI = escapeBase | 0x1C
+	NetworkParameterWrite       APCI = escapeBase | 0x1D
+	DomainAddressWrite          APCI = escapeBase | 0x20
+	DomainAddressRead           APCI = escapeBase | 0x21
+	DomainAddressResponse       APCI = escapeBase | 0x22
+	MemoryExtendedWrite         APCI = escapeBase | 0x3B
+	MemoryExtendedWriteResponse APCI = escapeBase | 0x3C
+	MemoryExtendedRead          APCI = escapeBase | 0x3D
+	MemoryExtendedReadResponse  APCI = escapeBase | 0x3E
+)
+
+// IsExtended reports whether apci is one of the extended (Escape-carried)
+// codes rather than one of the 4-bit codes carried directly in the header.
+func (apci APCI) IsExtended() bool {
+	return apci > Escape
+}
+
 // A TPDU is the transport-layer protocol data unit within a L_Data frame.
 type TPDU struct {
 	PacketType TPCI
@@ -51,24 +88,37 @@ type TPDU struct {
 	Data       []byte
 }
 
-// Errors returned from ReadTPDU
+// MaxAPDULength is the maximum length, in bytes, of the application data
+// (the octet after the TPCI octet, which carries the low APCI bits, plus
+// TPDU.Data) a TPDU may carry per the KNX specification.
+const MaxAPDULength = 254
+
+// Errors returned from UnmarshalBinary/ReadFrom.
 var (
-	ErrDataUnitTooShort = errors.New("Data segment of the TPDU is too short")
+	ErrDataUnitTooShort = errors.New("proto: data segment of the TPDU is too short")
+	ErrAPDUTooLong      = errors.New("proto: APDU exceeds the maximum length of 254 bytes")
+	ErrReservedBitsSet  = errors.New("proto: reserved sequence-number bits are set on an unnumbered packet")
+	ErrInvalidTPDU      = errors.New("proto: malformed TPDU")
 )
 
-// ReadFrom parses the given data in order to fill the TPDU struct.
-func (tpdu *TPDU) ReadFrom(r io.Reader) error {
-	var head uint8
-	err := binary.ReadSequence(r, &head)
-	if err != nil {
-		return err
+// UnmarshalBinary parses data in order to fill the TPDU struct. data must
+// hold exactly one TPDU; it never reads more than MaxAPDULength+1 bytes and
+// never panics, making it safe to call on attacker-controlled input.
+func (tpdu *TPDU) UnmarshalBinary(data []byte) error {
+	if len(data) < 1 {
+		return ErrDataUnitTooShort
 	}
 
+	head := data[0]
 	packetType := TPCI((head >> 6) & 3)
 	seqNumber := (head >> 2) & 15
 
 	switch packetType {
 	case UnnumberedControlPacket, NumberedControlPacket:
+		if packetType == UnnumberedControlPacket && seqNumber != 0 {
+			return ErrReservedBitsSet
+		}
+
 		tpdu.PacketType = packetType
 		tpdu.SeqNumber = seqNumber
 		tpdu.Control = head & 3
@@ -78,22 +128,33 @@ func (tpdu *TPDU) ReadFrom(r io.Reader) error {
 		return nil
 
 	case UnnumberedDataPacket, NumberedDataPacket:
-		buffer := &bytes.Buffer{}
-		len, err := buffer.ReadFrom(r)
-		if err != nil {
-			return err
-		} else if len < 1 {
+		if packetType == UnnumberedDataPacket && seqNumber != 0 {
+			return ErrReservedBitsSet
+		}
+
+		rest := data[1:]
+		if len(rest) < 1 {
 			return ErrDataUnitTooShort
+		} else if len(rest) > MaxAPDULength {
+			return ErrAPDUTooLong
 		}
 
-		data := buffer.Bytes()
-		info := APCI((head & 3) << 2 | (data[0] >> 6) & 3)
+		info := APCI((head & 3) << 2 | (rest[0] >> 6) & 3)
 
 		var appData []byte
-		if len > 1 {
-			appData = data[1:]
+		if info == Escape {
+			info = escapeBase | APCI(rest[0]&63)
+			appData = append([]byte(nil), rest[1:]...)
+		} else if len(rest) > 1 {
+			appData = append([]byte(nil), rest[1:]...)
+		} else if v := rest[0] & 63; v != 0 {
+			appData = []byte{v}
 		} else {
-			appData = []byte{data[0] & 63}
+			// A zero compressed value is indistinguishable on the wire
+			// from a TPDU that carries no data at all (e.g. GroupValueRead,
+			// MaskVersionRead, Restart); normalize to nil so it matches what
+			// MarshalBinary emits for Data == nil and round-trips.
+			appData = nil
 		}
 
 		tpdu.PacketType = packetType
@@ -105,13 +166,19 @@ func (tpdu *TPDU) ReadFrom(r io.Reader) error {
 		return nil
 	}
 
-	return errors.New("Unreachable")
+	// Unreachable: packetType only ever has 2 bits, and the two cases above
+	// already cover all four possible values.
+	return ErrInvalidTPDU
 }
 
-// WriteTo writes the TPDU structure to the given Writer.
-func (tpdu *TPDU) WriteTo(w io.Writer) error {
+// MarshalBinary encodes the TPDU struct into its wire representation.
+func (tpdu *TPDU) MarshalBinary() ([]byte, error) {
+	if len(tpdu.Data)+1 > MaxAPDULength {
+		return nil, ErrAPDUTooLong
+	}
+
 	buffer := []byte{
-		byte(tpdu.PacketType & 3) << 6 | byte(tpdu.SeqNumber & 15) << 2,
+		byte(tpdu.PacketType&3)<<6 | byte(tpdu.SeqNumber&15)<<2,
 	}
 
 	switch tpdu.PacketType {
@@ -119,17 +186,66 @@ func (tpdu *TPDU) WriteTo(w io.Writer) error {
 		buffer[0] |= byte(tpdu.Control & 3)
 
 	case UnnumberedDataPacket, NumberedDataPacket:
-		buffer[0] |= byte(tpdu.Info >> 2) & 3
-
-		if len(tpdu.Data) > 0 {
+		if tpdu.Info.IsExtended() {
+			buffer[0] |= byte(Escape>>2) & 3
+			buffer = append(buffer, byte(Escape&3)<<6|byte(tpdu.Info)&63)
 			buffer = append(buffer, tpdu.Data...)
-			buffer[1] &= 63
-			buffer[1] |= byte(tpdu.Info & 3) << 6
 		} else {
-			buffer = []byte{buffer[0], byte(tpdu.Info & 3) << 6}
+			buffer[0] |= byte(tpdu.Info>>2) & 3
+
+			if len(tpdu.Data) == 1 && tpdu.Data[0] > 0 && tpdu.Data[0] < 64 {
+				// 6-bit compressed-data form: the value fits alongside the
+				// APCI in a single octet. A zero value is deliberately
+				// excluded: it would be indistinguishable on the wire from
+				// Data == nil, so UnmarshalBinary always reads a compressed
+				// zero back as nil (see its comment) and an explicit
+				// single-zero-byte Data has to take the full form below to
+				// still round-trip.
+				buffer = append(buffer, byte(tpdu.Info&3)<<6|tpdu.Data[0])
+			} else {
+				// Full form: the octet following the header only carries
+				// the low 2 APCI bits, the actual data starts at the next
+				// one. This octet is synthesised rather than derived from
+				// tpdu.Data so that Data round-trips through
+				// Unmarshal(Marshal(tpdu)) unchanged.
+				buffer = append(buffer, byte(tpdu.Info&3)<<6)
+				buffer = append(buffer, tpdu.Data...)
+			}
 		}
+
+	default:
+		return nil, ErrInvalidTPDU
+	}
+
+	return buffer, nil
+}
+
+// ReadFrom parses the given data in order to fill the TPDU struct. It never
+// reads more than MaxAPDULength+2 bytes from r, so a misbehaving or
+// malicious reader cannot make it buffer unbounded data.
+func (tpdu *TPDU) ReadFrom(r io.Reader) error {
+	var buffer [MaxAPDULength + 2]byte
+
+	n, err := io.ReadFull(io.LimitReader(r, int64(len(buffer))), buffer[:])
+	if err == io.ErrUnexpectedEOF || err == io.EOF {
+		err = nil
+	}
+	if err != nil {
+		return err
+	} else if n == 0 {
+		return ErrDataUnitTooShort
+	}
+
+	return tpdu.UnmarshalBinary(buffer[:n])
+}
+
+// WriteTo writes the TPDU structure to the given Writer.
+func (tpdu *TPDU) WriteTo(w io.Writer) error {
+	data, err := tpdu.MarshalBinary()
+	if err != nil {
+		return err
 	}
 
-	_, err := w.Write(buffer)
+	_, err = w.Write(data)
 	return err
 }
@@ -0,0 +1,129 @@
+package proto
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestTPDURoundTrip(t *testing.T) {
+	cases := []TPDU{
+		{PacketType: UnnumberedControlPacket, Control: Connect},
+		{PacketType: UnnumberedControlPacket, Control: Disconnect},
+		{PacketType: NumberedControlPacket, SeqNumber: 7, Control: Ack},
+		{PacketType: NumberedControlPacket, SeqNumber: 15, Control: Nak},
+		{PacketType: UnnumberedDataPacket, Info: GroupValueRead, Data: nil},
+		{PacketType: UnnumberedDataPacket, Info: GroupValueWrite, Data: []byte{1}},
+		{PacketType: UnnumberedDataPacket, Info: MaskVersionRead, Data: nil},
+		{PacketType: UnnumberedDataPacket, Info: Restart, Data: nil},
+		{PacketType: NumberedDataPacket, SeqNumber: 3, Info: MemoryWrite, Data: []byte{2, 0x12, 0x34, 0xAB, 0xCD}},
+		{PacketType: NumberedDataPacket, SeqNumber: 9, Info: AdcResponse, Data: []byte{1, 200}},
+		{PacketType: UnnumberedDataPacket, Info: MaskVersionResponse, Data: []byte{0x07, 0xB0}},
+		{PacketType: NumberedDataPacket, SeqNumber: 1, Info: PropertyValueRead, Data: []byte{0x01, 0x0C, 0x01, 0x00, 0x01}},
+		{PacketType: NumberedDataPacket, SeqNumber: 2, Info: MemoryExtendedWrite, Data: nil},
+	}
+
+	for _, want := range cases {
+		data, err := want.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary(%+v): %v", want, err)
+		}
+
+		var got TPDU
+		if err := got.UnmarshalBinary(data); err != nil {
+			t.Fatalf("UnmarshalBinary(%x): %v", data, err)
+		}
+
+		if !reflect.DeepEqual(want, got) {
+			t.Fatalf("round-trip mismatch: want %+v, got %+v (wire %x)", want, got, data)
+		}
+	}
+}
+
+// TestTPDUMarshalEmptyDataRoundTrip guards against a regression where a TPDU
+// built with a nil Data field, like app.GroupValueRead and friends actually
+// construct, came back out of UnmarshalBinary(MarshalBinary(x)) with
+// Data: []byte{0} instead of nil.
+func TestTPDUMarshalEmptyDataRoundTrip(t *testing.T) {
+	want := TPDU{PacketType: UnnumberedDataPacket, Info: GroupValueRead}
+
+	data, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatalf("MarshalBinary: %v", err)
+	}
+
+	var got TPDU
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatalf("UnmarshalBinary(%x): %v", data, err)
+	}
+
+	if !reflect.DeepEqual(want, got) {
+		t.Fatalf("round-trip mismatch: want %+v, got %+v (wire %x)", want, got, data)
+	}
+}
+
+func TestTPDUReadFromBounded(t *testing.T) {
+	var tpdu TPDU
+
+	huge := append([]byte{0x00}, bytes.Repeat([]byte{0xFF}, 10*MaxAPDULength)...)
+	if err := tpdu.ReadFrom(bytes.NewReader(huge)); err != ErrAPDUTooLong {
+		t.Fatalf("expected ErrAPDUTooLong reading an oversized stream, got %v", err)
+	}
+}
+
+func TestTPDUUnmarshalBinaryErrors(t *testing.T) {
+	cases := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrDataUnitTooShort},
+		{"data packet without data", []byte{0x00}, ErrDataUnitTooShort},
+		{"reserved seq bits on unnumbered data", []byte{0x04, 0x00}, ErrReservedBitsSet},
+		{"reserved seq bits on unnumbered control", []byte{0x84}, ErrReservedBitsSet},
+		{"oversize APDU", append([]byte{0x40}, bytes.Repeat([]byte{0}, MaxAPDULength+1)...), ErrAPDUTooLong},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var tpdu TPDU
+			if err := tpdu.UnmarshalBinary(c.data); err != c.want {
+				t.Fatalf("got %v, want %v", err, c.want)
+			}
+		})
+	}
+}
+
+// FuzzTPDUUnmarshalBinary checks that UnmarshalBinary never panics on
+// arbitrary input and that, whenever it succeeds, re-encoding the result and
+// parsing it again yields the identical TPDU.
+func FuzzTPDUUnmarshalBinary(f *testing.F) {
+	f.Add([]byte{0x00})
+	f.Add([]byte{0x84})
+	f.Add([]byte{0x00, 0x00})
+	f.Add([]byte{0x40, 0xC1, 0x01, 0x02, 0x03})
+	f.Add([]byte{0x50, 0xF5})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var tpdu TPDU
+
+		err := tpdu.UnmarshalBinary(data)
+		if err != nil {
+			return
+		}
+
+		reencoded, err := tpdu.MarshalBinary()
+		if err != nil {
+			t.Fatalf("MarshalBinary of a successfully parsed TPDU failed: %v", err)
+		}
+
+		var again TPDU
+		if err := again.UnmarshalBinary(reencoded); err != nil {
+			t.Fatalf("UnmarshalBinary(MarshalBinary(tpdu)) failed: %v", err)
+		}
+
+		if !reflect.DeepEqual(tpdu, again) {
+			t.Fatalf("round-trip mismatch: %+v != %+v", tpdu, again)
+		}
+	})
+}
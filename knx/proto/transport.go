@@ -0,0 +1,301 @@
+package proto
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/vapourismo/knx-go/knx/cemi"
+)
+
+// Control codes carried in the two Control bits of a control TPDU.
+const (
+	Connect    uint8 = 0 // T_CONNECT, carried in an UnnumberedControlPacket
+	Disconnect uint8 = 1 // T_DISCONNECT, carried in an UnnumberedControlPacket
+	Ack        uint8 = 2 // T_ACK, carried in a NumberedControlPacket
+	Nak        uint8 = 3 // T_NAK, carried in a NumberedControlPacket
+)
+
+// RetransmitTimeout is the time ConnectionOrientedTransport waits for a
+// T_ACK before retransmitting an unacknowledged numbered data packet. It is a
+// var rather than a const so tests can shrink it.
+var RetransmitTimeout = 3 * time.Second
+
+// MaxRetransmits is the number of times ConnectionOrientedTransport
+// retransmits an unacknowledged numbered data packet before tearing the
+// connection down.
+const MaxRetransmits = 3
+
+// Errors returned by ConnectionOrientedTransport.
+var (
+	ErrNotConnected     = errors.New("proto: no connection to that address")
+	ErrAlreadyConnected = errors.New("proto: already connected to that address")
+	ErrConnectionClosed = errors.New("proto: connection was torn down")
+	ErrRetriesExceeded  = errors.New("proto: retransmission limit exceeded")
+)
+
+// A FrameSender sends a raw TPDU to a KNX individual address, for example
+// over a KNXnet/IP tunnel or router connection.
+type FrameSender interface {
+	Send(dest cemi.IndividualAddr, tpdu TPDU) error
+}
+
+// A Payload is an in-order application-layer TPDU delivered by a
+// ConnectionOrientedTransport.
+type Payload struct {
+	Source cemi.IndividualAddr
+	Info   APCI
+	Data   []byte
+}
+
+// pendingSend tracks a numbered data packet that is waiting for its T_ACK.
+type pendingSend struct {
+	tpdu    TPDU
+	retries int
+	timer   *time.Timer
+	done    chan error
+}
+
+// connection is the per-peer state of a point-to-point transport connection.
+type connection struct {
+	connected bool
+	sendSeq   uint8 // sequence number to use for the next outbound data packet
+	recvSeq   uint8 // sequence number expected of the next inbound data packet
+	pending   *pendingSend
+}
+
+// A ConnectionOrientedTransport implements the numbered (connection-oriented)
+// KNX transport layer on top of TPDU: it maintains one sequence-number state
+// machine per peer individual address, acknowledges and retransmits numbered
+// data packets, and delivers in-order application payloads to consumers.
+// This is required by point-to-point services such as MemoryRead/Write,
+// property access and device programming.
+type ConnectionOrientedTransport struct {
+	sender FrameSender
+
+	mu    sync.Mutex
+	conns map[cemi.IndividualAddr]*connection
+
+	inbound chan Payload
+}
+
+// NewConnectionOrientedTransport creates a ConnectionOrientedTransport that
+// sends outbound TPDUs through sender.
+func NewConnectionOrientedTransport(sender FrameSender) *ConnectionOrientedTransport {
+	return &ConnectionOrientedTransport{
+		sender:  sender,
+		conns:   make(map[cemi.IndividualAddr]*connection),
+		inbound: make(chan Payload, 16),
+	}
+}
+
+// Inbound returns the channel on which in-order application payloads from
+// all connected peers are delivered.
+func (t *ConnectionOrientedTransport) Inbound() <-chan Payload {
+	return t.inbound
+}
+
+// Connect opens a point-to-point connection to addr by sending T_CONNECT.
+func (t *ConnectionOrientedTransport) Connect(addr cemi.IndividualAddr) error {
+	t.mu.Lock()
+	if conn, ok := t.conns[addr]; ok && conn.connected {
+		t.mu.Unlock()
+		return ErrAlreadyConnected
+	}
+
+	t.conns[addr] = &connection{connected: true}
+	t.mu.Unlock()
+
+	return t.sender.Send(addr, TPDU{PacketType: UnnumberedControlPacket, Control: Connect})
+}
+
+// Disconnect tears the connection to addr down by sending T_DISCONNECT and
+// discarding all local state for it.
+func (t *ConnectionOrientedTransport) Disconnect(addr cemi.IndividualAddr) error {
+	t.mu.Lock()
+	conn, ok := t.conns[addr]
+	if !ok || !conn.connected {
+		t.mu.Unlock()
+		return ErrNotConnected
+	}
+
+	t.teardown(addr, conn, ErrConnectionClosed)
+	t.mu.Unlock()
+
+	return t.sender.Send(addr, TPDU{PacketType: UnnumberedControlPacket, Control: Disconnect})
+}
+
+// Send transmits a numbered data packet carrying info/data to addr and
+// blocks until it has been acknowledged, retransmitting up to
+// MaxRetransmits times on timeout. The connection is torn down if the
+// retransmission limit is exceeded or a T_NAK is received too often.
+func (t *ConnectionOrientedTransport) Send(addr cemi.IndividualAddr, info APCI, data []byte) error {
+	t.mu.Lock()
+	conn, ok := t.conns[addr]
+	if !ok || !conn.connected {
+		t.mu.Unlock()
+		return ErrNotConnected
+	}
+
+	if conn.pending != nil {
+		t.mu.Unlock()
+		return errors.New("proto: a send is already in flight to that address")
+	}
+
+	tpdu := TPDU{
+		PacketType: NumberedDataPacket,
+		SeqNumber:  conn.sendSeq,
+		Info:       info,
+		Data:       data,
+	}
+
+	send := &pendingSend{tpdu: tpdu, done: make(chan error, 1)}
+	conn.pending = send
+	t.armRetransmit(addr, conn, send)
+	t.mu.Unlock()
+
+	if err := t.sender.Send(addr, tpdu); err != nil {
+		t.mu.Lock()
+		t.teardown(addr, conn, err)
+		t.mu.Unlock()
+		return err
+	}
+
+	return <-send.done
+}
+
+// armRetransmit (re-)starts the retransmission timer for send. t.mu must be
+// held by the caller.
+func (t *ConnectionOrientedTransport) armRetransmit(addr cemi.IndividualAddr, conn *connection, send *pendingSend) {
+	send.timer = time.AfterFunc(RetransmitTimeout, func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+
+		if conn.pending != send {
+			return
+		}
+
+		t.retransmit(addr, conn, send)
+	})
+}
+
+// retransmit resends send's TPDU and rearms its retransmission timer from
+// scratch, tearing the connection down instead once the retry limit has
+// been reached. It is the single path used by both a timeout and an
+// incoming T_NAK, so the two never race each other with independently
+// ticking timers. t.mu must be held by the caller.
+func (t *ConnectionOrientedTransport) retransmit(addr cemi.IndividualAddr, conn *connection, send *pendingSend) {
+	if send.retries >= MaxRetransmits {
+		t.teardown(addr, conn, ErrRetriesExceeded)
+		return
+	}
+
+	send.retries++
+	send.timer.Stop()
+	t.armRetransmit(addr, conn, send)
+
+	go t.sender.Send(addr, send.tpdu)
+}
+
+// teardown discards all state for the connection to addr and unblocks any
+// pending Send with err. t.mu must be held by the caller.
+func (t *ConnectionOrientedTransport) teardown(addr cemi.IndividualAddr, conn *connection, err error) {
+	if conn.pending != nil {
+		conn.pending.timer.Stop()
+		conn.pending.done <- err
+		conn.pending = nil
+	}
+
+	conn.connected = false
+	delete(t.conns, addr)
+}
+
+// Dispatch feeds a TPDU received from source into the state machine. It
+// should be called for every inbound TPDU addressed to this device.
+func (t *ConnectionOrientedTransport) Dispatch(source cemi.IndividualAddr, tpdu TPDU) {
+	switch tpdu.PacketType {
+	case UnnumberedControlPacket:
+		t.dispatchUnnumberedControl(source, tpdu)
+
+	case NumberedControlPacket:
+		t.dispatchNumberedControl(source, tpdu)
+
+	case NumberedDataPacket:
+		t.dispatchNumberedData(source, tpdu)
+
+	case UnnumberedDataPacket:
+		t.inbound <- Payload{Source: source, Info: tpdu.Info, Data: tpdu.Data}
+	}
+}
+
+func (t *ConnectionOrientedTransport) dispatchUnnumberedControl(source cemi.IndividualAddr, tpdu TPDU) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	switch tpdu.Control {
+	case Connect:
+		t.conns[source] = &connection{connected: true}
+
+	case Disconnect:
+		if conn, ok := t.conns[source]; ok {
+			t.teardown(source, conn, ErrConnectionClosed)
+		}
+	}
+}
+
+func (t *ConnectionOrientedTransport) dispatchNumberedControl(source cemi.IndividualAddr, tpdu TPDU) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	conn, ok := t.conns[source]
+	if !ok || conn.pending == nil || conn.pending.tpdu.SeqNumber != tpdu.SeqNumber {
+		return
+	}
+
+	send := conn.pending
+
+	switch tpdu.Control {
+	case Ack:
+		conn.sendSeq = (conn.sendSeq + 1) & 15
+		t.teardown0(conn, send, nil)
+
+	case Nak:
+		t.retransmit(source, conn, send)
+	}
+}
+
+// teardown0 clears the pending send without discarding the connection
+// itself. t.mu must be held by the caller.
+func (t *ConnectionOrientedTransport) teardown0(conn *connection, send *pendingSend, err error) {
+	send.timer.Stop()
+	send.done <- err
+	conn.pending = nil
+}
+
+func (t *ConnectionOrientedTransport) dispatchNumberedData(source cemi.IndividualAddr, tpdu TPDU) {
+	t.mu.Lock()
+	conn, ok := t.conns[source]
+	if !ok {
+		t.mu.Unlock()
+		return
+	}
+
+	switch {
+	case tpdu.SeqNumber == conn.recvSeq:
+		conn.recvSeq = (conn.recvSeq + 1) & 15
+		t.mu.Unlock()
+
+		t.sender.Send(source, TPDU{PacketType: NumberedControlPacket, SeqNumber: tpdu.SeqNumber, Control: Ack})
+		t.inbound <- Payload{Source: source, Info: tpdu.Info, Data: tpdu.Data}
+
+	case tpdu.SeqNumber == (conn.recvSeq+15)&15:
+		// Duplicate of the packet we already acknowledged; re-ack without
+		// delivering it again.
+		t.mu.Unlock()
+		t.sender.Send(source, TPDU{PacketType: NumberedControlPacket, SeqNumber: tpdu.SeqNumber, Control: Ack})
+
+	default:
+		t.mu.Unlock()
+		t.sender.Send(source, TPDU{PacketType: NumberedControlPacket, SeqNumber: tpdu.SeqNumber, Control: Nak})
+	}
+}
@@ -0,0 +1,172 @@
+package proto
+
+import (
+	"testing"
+	"time"
+
+	"github.com/vapourismo/knx-go/knx/cemi"
+)
+
+// sentFrame is one TPDU handed to a fakeSender.
+type sentFrame struct {
+	addr cemi.IndividualAddr
+	tpdu TPDU
+}
+
+// fakeSender is a FrameSender that records every TPDU it is asked to send
+// instead of putting it on the wire.
+type fakeSender struct {
+	frames chan sentFrame
+}
+
+func newFakeSender() *fakeSender {
+	return &fakeSender{frames: make(chan sentFrame, 16)}
+}
+
+func (f *fakeSender) Send(addr cemi.IndividualAddr, tpdu TPDU) error {
+	f.frames <- sentFrame{addr, tpdu}
+	return nil
+}
+
+// recv waits for the next frame sent through f, failing the test if none
+// arrives in time.
+func (f *fakeSender) recv(t *testing.T) sentFrame {
+	t.Helper()
+
+	select {
+	case frame := <-f.frames:
+		return frame
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for a frame to be sent")
+		return sentFrame{}
+	}
+}
+
+func newConnected(t *testing.T, sender *fakeSender) (*ConnectionOrientedTransport, cemi.IndividualAddr) {
+	t.Helper()
+
+	transport := NewConnectionOrientedTransport(sender)
+	addr := cemi.IndividualAddr(1)
+
+	if err := transport.Connect(addr); err != nil {
+		t.Fatalf("Connect: %v", err)
+	}
+	sender.recv(t) // the outgoing T_CONNECT
+
+	return transport, addr
+}
+
+func TestConnectionOrientedTransportAck(t *testing.T) {
+	sender := newFakeSender()
+	transport, addr := newConnected(t, sender)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- transport.Send(addr, GroupValueRead, []byte{1})
+	}()
+
+	data := sender.recv(t)
+	if data.tpdu.PacketType != NumberedDataPacket {
+		t.Fatalf("expected a NumberedDataPacket, got %+v", data.tpdu)
+	}
+
+	transport.Dispatch(addr, TPDU{PacketType: NumberedControlPacket, SeqNumber: data.tpdu.SeqNumber, Control: Ack})
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+}
+
+func TestConnectionOrientedTransportNakRetries(t *testing.T) {
+	sender := newFakeSender()
+	transport, addr := newConnected(t, sender)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- transport.Send(addr, GroupValueRead, []byte{1})
+	}()
+
+	first := sender.recv(t)
+
+	transport.Dispatch(addr, TPDU{PacketType: NumberedControlPacket, SeqNumber: first.tpdu.SeqNumber, Control: Nak})
+
+	retry := sender.recv(t)
+	if retry.tpdu.SeqNumber != first.tpdu.SeqNumber || retry.tpdu.PacketType != NumberedDataPacket {
+		t.Fatalf("expected a retransmit of %+v, got %+v", first.tpdu, retry.tpdu)
+	}
+
+	transport.Dispatch(addr, TPDU{PacketType: NumberedControlPacket, SeqNumber: retry.tpdu.SeqNumber, Control: Ack})
+
+	if err := <-errCh; err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+}
+
+func TestConnectionOrientedTransportTimeoutTearsDown(t *testing.T) {
+	old := RetransmitTimeout
+	RetransmitTimeout = 20 * time.Millisecond
+	defer func() { RetransmitTimeout = old }()
+
+	sender := newFakeSender()
+	transport, addr := newConnected(t, sender)
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- transport.Send(addr, GroupValueRead, []byte{1})
+	}()
+
+	// The initial send plus MaxRetransmits timeout-driven retransmits, all
+	// carrying the same, never-acknowledged sequence number.
+	for i := 0; i < MaxRetransmits+1; i++ {
+		sender.recv(t)
+	}
+
+	select {
+	case err := <-errCh:
+		if err != ErrRetriesExceeded {
+			t.Fatalf("Send: got %v, want ErrRetriesExceeded", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for Send to give up")
+	}
+
+	if err := transport.Disconnect(addr); err != ErrNotConnected {
+		t.Fatalf("Disconnect after teardown: got %v, want ErrNotConnected", err)
+	}
+}
+
+func TestConnectionOrientedTransportDuplicateSeqReAcksWithoutRedelivery(t *testing.T) {
+	sender := newFakeSender()
+	transport, addr := newConnected(t, sender)
+
+	tpdu := TPDU{PacketType: NumberedDataPacket, SeqNumber: 0, Info: GroupValueWrite, Data: []byte{1}}
+
+	transport.Dispatch(addr, tpdu)
+	ack := sender.recv(t)
+	if ack.tpdu.Control != Ack || ack.tpdu.SeqNumber != 0 {
+		t.Fatalf("expected an ack for seq 0, got %+v", ack.tpdu)
+	}
+
+	select {
+	case payload := <-transport.Inbound():
+		if payload.Source != addr {
+			t.Fatalf("unexpected payload source %v", payload.Source)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for the first delivery")
+	}
+
+	// Resend of the same sequence number, as a peer would after losing our
+	// ack: it must be re-acked but not delivered a second time.
+	transport.Dispatch(addr, tpdu)
+	ack = sender.recv(t)
+	if ack.tpdu.Control != Ack || ack.tpdu.SeqNumber != 0 {
+		t.Fatalf("expected a re-ack for seq 0, got %+v", ack.tpdu)
+	}
+
+	select {
+	case payload := <-transport.Inbound():
+		t.Fatalf("duplicate was redelivered: %+v", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}